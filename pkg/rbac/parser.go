@@ -20,26 +20,73 @@ limitations under the License.
 // The markers take the form:
 //
 //  +kubebuilder:rbac:groups=<groups>,resources=<resources>,resourceNames=<resource names>,verbs=<verbs>,urls=<non resource urls>
+//
+// The generated ClusterRoles can be aggregated into other ClusterRoles with:
+//
+//  +kubebuilder:rbac:aggregate:to=<cluster roles>,labels=<aggregation labels>,role=<role name>
 package rbac
 
 import (
 	"fmt"
+	"go/ast"
+	"reflect"
 	"sort"
 	"strings"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
 	"sigs.k8s.io/controller-tools/pkg/markers"
+	"sigs.k8s.io/controller-tools/pkg/version"
 )
 
 var (
 	// RuleDefinition is a marker for defining RBAC rules.
 	// Call ToRule on the value to get a Kubernetes RBAC policy rule.
 	RuleDefinition = markers.Must(markers.MakeDefinition("kubebuilder:rbac", markers.DescribesPackage, Rule{}))
+
+	// AggregateDefinition is a marker for aggregating the generated ClusterRole
+	// into other ClusterRoles.
+	AggregateDefinition = markers.Must(markers.MakeDefinition("kubebuilder:rbac:aggregate", markers.DescribesPackage, Aggregate{}))
+)
+
+var (
+	// resourceVerbs are the verbs that may be granted on API resources:
+	// the standard API verbs, plus the special verbs used by the RBAC,
+	// impersonation, policy and certificates APIs.
+	resourceVerbs = sets.NewString(
+		"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection",
+		"bind", "escalate", "impersonate", "use", "approve", "sign",
+	)
+	// nonResourceVerbs are the (lowercase) HTTP verbs that may be granted on
+	// non-resource URLs.
+	nonResourceVerbs = sets.NewString("get", "post", "put", "patch", "delete", "head", "options")
+	// standardResourceVerbs are the verbs a wildcard verb is expanded to
+	// on API resources.
+	standardResourceVerbs = sets.NewString(
+		"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection",
+	)
+	// unnamedVerbs are the verbs whose requests aren't for a single named
+	// resource, so they can't be granted by rules limited to resourceNames.
+	unnamedVerbs = sets.NewString("create", "deletecollection")
+	// verbAliases are shorthands for common sets of verbs on API resources.
+	// They're matched case-insensitively.
+	verbAliases = map[string][]string{
+		"read-only":  {"get", "list", "watch"},
+		"read-write": {"get", "list", "watch", "create", "update", "patch", "delete"},
+		"all":        {rbacv1.VerbAll},
+	}
 )
 
+// aggregateToLabelPrefix is the prefix of the labels selected by the
+// aggregationRules of the default user-facing ClusterRoles.
+const aggregateToLabelPrefix = "rbac.authorization.k8s.io/aggregate-to-"
+
 // +controllertools:marker:generateHelp:category=RBAC
 
 // Rule specifies an RBAC rule to all access to some resources or non-resource URLs.
@@ -54,6 +101,10 @@ type Rule struct {
 	// is not known at authorization time.
 	ResourceNames []string `marker:",optional"`
 	// Verbs specifies the (lowercase) kubernetes API verbs that this rule encompasses.
+	//
+	// For API resources, the aliases read-only (get, list and watch),
+	// read-write (read-only plus create, update, patch and delete) and
+	// all (*) may be used as well.
 	Verbs []string
 	// URL specifies the non-resource URLs that this rule encompasses.
 	URLs []string `marker:"urls,optional"`
@@ -61,6 +112,50 @@ type Rule struct {
 	// If not set, the Rule belongs to the generated ClusterRole.
 	// If set, the Rule belongs to a Role, whose namespace is specified by this field.
 	Namespace string `marker:",optional"`
+	// Role specifies the name of the ClusterRole or Role the Rule belongs to,
+	// to split the permissions of a controller into several roles.
+	// If not set, the Rule belongs to the role named by the generator's
+	// roleName option.
+	Role string `marker:",optional"`
+}
+
+// +controllertools:marker:generateHelp:category=RBAC
+
+// Aggregate specifies ClusterRoles that a generated ClusterRole should be aggregated into.
+type Aggregate struct {
+	// To specifies the names of the aggregating ClusterRoles, e.g. admin, edit or view.
+	//
+	// The generated ClusterRole is labeled with
+	// `rbac.authorization.k8s.io/aggregate-to-<name>: "true"` for each of them,
+	// which is what the aggregationRules of the default user-facing roles select on.
+	To []string `marker:",optional"`
+	// Labels specifies additional labels to set on the generated ClusterRole,
+	// for aggregated ClusterRoles selecting on labels of their own, e.g.
+	// `{rbac.example.com/aggregate-to-manager: "true"}`.
+	Labels map[string]string `marker:",optional"`
+	// Role specifies the name of the generated ClusterRole to aggregate,
+	// as set with the role argument of rule markers.
+	// If not set, the ClusterRole named by the generator's roleName option is aggregated.
+	Role string `marker:",optional"`
+}
+
+// labels returns the labels that aggregate a ClusterRole into the ClusterRoles listed in a.
+func (a Aggregate) labels() map[string]string {
+	labels := make(map[string]string, len(a.To)+len(a.Labels))
+	for _, to := range a.To {
+		labels[aggregateToLabelPrefix+to] = "true"
+	}
+	for key, value := range a.Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// roleRef identifies one of the generated roles.  Roles without a namespace
+// are ClusterRoles.
+type roleRef struct {
+	Name      string
+	Namespace string
 }
 
 // ruleKey represents the resources and non-resources a Rule applies.
@@ -96,18 +191,86 @@ func (r *Rule) key() ruleKey {
 // addVerbs adds new verbs into a Rule.
 // The duplicates in `r.Verbs` will be removed, and then `r.Verbs` will be sorted.
 func (r *Rule) addVerbs(verbs []string) {
-	r.Verbs = removeDupAndSort(append(r.Verbs, verbs...))
+	r.Verbs = normalizeVerbs(append(r.Verbs, verbs...))
+}
+
+// covers reports whether r grants everything that other grants, which is
+// the case when r grants a superset of the verbs of other on all the
+// resources of the same API groups.
+// Both Rules are expected to be normalized.
+func (r *Rule) covers(other *Rule) bool {
+	if len(r.Resources) != 1 || r.Resources[0] != rbacv1.ResourceAll || len(r.ResourceNames) != 0 {
+		return false
+	}
+	if len(r.URLs) != 0 || len(other.URLs) != 0 {
+		return false
+	}
+	if strings.Join(r.Groups, "&") != strings.Join(other.Groups, "&") {
+		return false
+	}
+	if len(r.Verbs) == 1 && r.Verbs[0] == rbacv1.VerbAll {
+		return true
+	}
+	verbs := make(map[string]bool, len(r.Verbs))
+	for _, verb := range r.Verbs {
+		verbs[verb] = true
+	}
+	for _, verb := range other.Verbs {
+		if !verbs[verb] {
+			return false
+		}
+	}
+	return true
 }
 
 // normalize removes duplicates from each field of a Rule, and sorts each field.
 func (r *Rule) normalize() {
-	r.Groups = removeDupAndSort(r.Groups)
+	r.Groups = removeDupAndSort(normalizeGroups(r.Groups))
 	r.Resources = removeDupAndSort(r.Resources)
 	r.ResourceNames = removeDupAndSort(r.ResourceNames)
-	r.Verbs = removeDupAndSort(r.Verbs)
+	if len(r.URLs) == 0 {
+		// verb aliases only stand for verbs on API resources
+		r.Verbs = expandVerbAliases(r.Verbs)
+	}
+	r.Verbs = normalizeVerbs(r.Verbs)
 	r.URLs = removeDupAndSort(r.URLs)
 }
 
+// normalizeGroups replaces the "core" alias with the actual (empty) name of
+// the core API group, so that rules spelling it either way are merged.
+func normalizeGroups(groups []string) []string {
+	for i, group := range groups {
+		if group == "core" {
+			groups[i] = ""
+		}
+	}
+	return groups
+}
+
+// normalizeVerbs removes duplicates from verbs and sorts them.  A wildcard
+// verb already grants every other verb, so it supersedes them.
+func normalizeVerbs(verbs []string) []string {
+	for _, verb := range verbs {
+		if verb == rbacv1.VerbAll {
+			return []string{rbacv1.VerbAll}
+		}
+	}
+	return removeDupAndSort(verbs)
+}
+
+// expandVerbAliases replaces the aliases in verbs with the verbs they stand for.
+func expandVerbAliases(verbs []string) []string {
+	var expanded []string
+	for _, verb := range verbs {
+		if aliased, isAlias := verbAliases[strings.ToLower(verb)]; isAlias {
+			expanded = append(expanded, aliased...)
+			continue
+		}
+		expanded = append(expanded, verb)
+	}
+	return expanded
+}
+
 // removeDupAndSort removes duplicates in strs, sorts the items, and returns a
 // new slice of strings.
 func removeDupAndSort(strs []string) []string {
@@ -126,14 +289,125 @@ func removeDupAndSort(strs []string) []string {
 	return result
 }
 
+// validate checks that the Rule is either a resource rule or a non-resource
+// rule, and that it only refers to well-formed API groups.  Unless
+// allowUnknownVerbs is set, it also checks that every verb is known.
+func (r *Rule) validate(allowUnknownVerbs bool) error {
+	var errs []error
+	if len(r.URLs) > 0 && (len(r.Groups) > 0 || len(r.Resources) > 0 || len(r.ResourceNames) > 0) {
+		errs = append(errs, fmt.Errorf("RBAC rule for non-resource URLs %v must not specify groups, resources or resourceNames", r.URLs))
+	}
+	if len(r.URLs) > 0 && r.Namespace != "" {
+		errs = append(errs, fmt.Errorf("RBAC rule for non-resource URLs %v must not specify a namespace, since only ClusterRoles can grant them", r.URLs))
+	}
+	for _, group := range r.Groups {
+		if group == "" || group == rbacv1.APIGroupAll {
+			continue
+		}
+		if msgs := validation.IsDNS1123Subdomain(group); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid API group %q: %s", group, strings.Join(msgs, ", ")))
+		}
+	}
+	for _, resource := range r.Resources {
+		if err := validateResource(resource); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !allowUnknownVerbs {
+		knownVerbs := resourceVerbs
+		if len(r.URLs) > 0 {
+			knownVerbs = nonResourceVerbs
+		}
+		verbs := r.Verbs
+		if len(r.URLs) == 0 {
+			verbs = expandVerbAliases(verbs)
+		}
+		for _, verb := range verbs {
+			if verb != rbacv1.VerbAll && !knownVerbs.Has(verb) {
+				errs = append(errs, fmt.Errorf("unknown verb %q in RBAC rule (set allowUnknownVerbs on the rbac generator to use it anyway)", verb))
+			}
+		}
+	}
+	return loader.MaybeErrList(errs)
+}
+
+// ineffectiveVerbs returns the verbs the Rule cannot grant, since
+// it's limited to resourceNames and their requests aren't for a named resource.
+func (r *Rule) ineffectiveVerbs() []string {
+	if len(r.ResourceNames) == 0 {
+		return nil
+	}
+	return unnamedVerbs.Intersection(sets.NewString(expandVerbAliases(r.Verbs)...)).List()
+}
+
+// grantsAll returns whether the Rule grants all verbs on all resources of
+// its API groups.  Rules limited to resourceNames never do.
+func (r *Rule) grantsAll() bool {
+	if len(r.ResourceNames) > 0 {
+		return false
+	}
+	verbs := sets.NewString(expandVerbAliases(r.Verbs)...)
+	resources := sets.NewString(r.Resources...)
+	return verbs.Has(rbacv1.VerbAll) && resources.Has(rbacv1.ResourceAll)
+}
+
+// validateResource checks that resource is of the form <resource> or
+// <resource>/<subresource>, where each part is a wildcard or a valid name.
+func validateResource(resource string) error {
+	parts := strings.Split(resource, "/")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid resource %q: must be of the form <resource> or <resource>/<subresource>", resource)
+	}
+	for _, part := range parts {
+		if part == rbacv1.ResourceAll {
+			continue
+		}
+		if msgs := validation.IsDNS1123Label(part); len(msgs) > 0 {
+			return fmt.Errorf("invalid resource %q: %s", resource, strings.Join(msgs, ", "))
+		}
+	}
+	return nil
+}
+
+// markerNode returns the comment holding the marker of the given definition
+// with the given value in file, so that errors about the value can point at
+// its marker.  If there's no such comment, file itself is returned.
+func markerNode(file *ast.File, def *markers.Definition, value interface{}) loader.Node {
+	for _, commentGroup := range file.Comments {
+		for _, comment := range commentGroup.List {
+			text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+			if !strings.HasPrefix(text, "+"+def.Name+":") {
+				continue
+			}
+			if val, err := def.Parse(text); err == nil && reflect.DeepEqual(val, value) {
+				return comment
+			}
+		}
+	}
+	return file
+}
+
+// expandWildcardVerbs replaces the wildcard verb of a normalized Rule with
+// the standard verbs it grants on the Rule's resources or non-resource URLs.
+// Rules limited to resourceNames don't get the verbs they cannot grant.
+func (r *Rule) expandWildcardVerbs() {
+	if len(r.Verbs) != 1 || r.Verbs[0] != rbacv1.VerbAll {
+		return
+	}
+	switch {
+	case len(r.URLs) > 0:
+		r.Verbs = nonResourceVerbs.List()
+	case len(r.ResourceNames) > 0:
+		r.Verbs = standardResourceVerbs.Difference(unnamedVerbs).List()
+	default:
+		r.Verbs = standardResourceVerbs.List()
+	}
+}
+
 // ToRule converts this rule to its Kubernetes API form.
 func (r *Rule) ToRule() rbacv1.PolicyRule {
 	// fix the group names first, since letting people type "core" is nice
-	for i, group := range r.Groups {
-		if group == "core" {
-			r.Groups[i] = ""
-		}
-	}
+	r.Groups = normalizeGroups(r.Groups)
 	return rbacv1.PolicyRule{
 		APIGroups:       r.Groups,
 		Verbs:           r.Verbs,
@@ -149,6 +423,60 @@ func (r *Rule) ToRule() rbacv1.PolicyRule {
 type Generator struct {
 	// RoleName sets the name of the generated ClusterRole.
 	RoleName string
+
+	// AllowUnknownVerbs disables the check that rules only use the known
+	// Kubernetes API verbs.
+	//
+	// This is needed for the custom verbs of some aggregated APIs.
+	AllowUnknownVerbs bool `marker:",optional"`
+
+	// AggregationSelector turns the ClusterRole into an aggregated role,
+	// combining the rules of all ClusterRoles with these labels.
+	//
+	// Its rules are then managed by Kubernetes, so rules without a
+	// namespace cannot be used alongside it.
+	AggregationSelector map[string]string `marker:",optional"`
+
+	// ExpandWildcardVerbs replaces the wildcard verb in the generated rules
+	// with the standard verbs it grants.
+	//
+	// This is for policy tooling that forbids wildcard verbs.  Unlike the
+	// wildcard, the expanded verbs do not include special verbs such as bind
+	// or escalate, unless other rules grant them explicitly.  Rules limited
+	// to resourceNames don't get create or deletecollection.
+	ExpandWildcardVerbs bool `marker:",optional"`
+
+	// FailOnEmpty makes generation fail if no roles are generated.
+	//
+	// This catches paths that don't point at the packages holding the
+	// RBAC markers.
+	FailOnEmpty bool `marker:",optional"`
+
+	// SkipVersionAnnotation omits the annotation recording the version of
+	// controller-gen from the generated roles.
+	SkipVersionAnnotation bool `marker:",optional"`
+
+	// Version sets the version of the RBAC API to generate roles for:
+	// v1 (the default) or v1beta1.
+	//
+	// v1beta1 is only needed for clusters older than Kubernetes 1.8; the
+	// roles are the same in both versions.
+	Version string `marker:",optional"`
+
+	// ForbidWildcardRules reports an error for rules granting all verbs on
+	// all resources of their API groups.
+	//
+	// For groups like core or apps, such rules are as good as cluster-admin,
+	// and are usually broader than intended.
+	ForbidWildcardRules bool `marker:",optional"`
+
+	// ForbidUnnamedVerbsOnNamedResources reports an error for rules limited
+	// to resourceNames that grant create or deletecollection.
+	//
+	// Requests for those verbs aren't for a named resource, so such rules
+	// never grant them.  (list and watch requests are, when they select a
+	// single object with a metadata.name field selector.)
+	ForbidUnnamedVerbsOnNamedResources bool `marker:",optional"`
 }
 
 func (Generator) RegisterMarkers(into *markers.Registry) error {
@@ -156,37 +484,114 @@ func (Generator) RegisterMarkers(into *markers.Registry) error {
 		return err
 	}
 	into.AddHelp(RuleDefinition, Rule{}.Help())
+	if err := into.Register(AggregateDefinition); err != nil {
+		return err
+	}
+	into.AddHelp(AggregateDefinition, Aggregate{}.Help())
 	return nil
 }
 
 // GenerateRoles generate a slice of objs representing either a ClusterRole or a Role object
-// The order of the objs in the returned slice is stable and determined by their namespaces.
+// The order of the objs in the returned slice is stable and determined by their namespaces and names.
 func GenerateRoles(ctx *genall.GenerationContext, roleName string) ([]interface{}, error) {
-	rulesByNS := make(map[string][]*Rule)
+	return Generator{RoleName: roleName}.generateRoles(ctx)
+}
+
+// generateRoles is GenerateRoles, respecting the options set on the Generator.
+func (g Generator) generateRoles(ctx *genall.GenerationContext) ([]interface{}, error) {
+	apiVersion, err := g.apiVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	// aggregateMarker is an Aggregate marker, along with where it came from
+	type aggregateMarker struct {
+		root     *loader.Package
+		file     *ast.File
+		value    Aggregate
+		roleName string
+	}
+
+	rulesByRole := make(map[roleRef][]*Rule)
+	aggregationLabels := make(map[string]map[string]string)
+	var aggregateMarkers []aggregateMarker
 	for _, root := range ctx.Roots {
-		markerSet, err := markers.PackageMarkers(ctx.Collector, root)
+		markersByFile, err := ctx.Collector.MarkersInPackage(root)
 		if err != nil {
 			root.AddError(err)
 		}
 
-		// group RBAC markers by namespace
-		for _, markerValue := range markerSet[RuleDefinition.Name] {
-			rule := markerValue.(Rule)
-			namespace := rule.Namespace
-			if _, ok := rulesByNS[namespace]; !ok {
-				rules := make([]*Rule, 0)
-				rulesByNS[namespace] = rules
+		// process the files one at a time, so that invalid rules can be
+		// reported against the file they came from
+		for _, file := range root.Syntax {
+			markerSet := markersByFile[file]
+
+			// group RBAC markers by role
+			for _, markerValue := range markerSet[RuleDefinition.Name] {
+				rule := markerValue.(Rule)
+				if err := rule.validate(g.AllowUnknownVerbs); err != nil {
+					root.AddError(loader.ErrFromNode(err, markerNode(file, RuleDefinition, rule)))
+					continue
+				}
+				if g.ForbidWildcardRules && rule.grantsAll() {
+					err := fmt.Errorf("RBAC rule grants all verbs on all resources of the API groups %v, which is forbidden by forbidWildcardRules", rule.Groups)
+					root.AddError(loader.ErrFromNode(err, markerNode(file, RuleDefinition, rule)))
+					continue
+				}
+				if verbs := rule.ineffectiveVerbs(); g.ForbidUnnamedVerbsOnNamedResources && len(verbs) > 0 {
+					err := fmt.Errorf("RBAC rule for resourceNames %v cannot grant verbs %v, since their requests are not restricted by name", rule.ResourceNames, verbs)
+					root.AddError(loader.ErrFromNode(err, markerNode(file, RuleDefinition, rule)))
+					continue
+				}
+				role := roleRef{Name: rule.Role, Namespace: rule.Namespace}
+				if role.Name == "" {
+					role.Name = g.RoleName
+				}
+				rulesByRole[role] = append(rulesByRole[role], &rule)
+			}
+
+			// collect the aggregation labels of the ClusterRoles
+			for _, markerValue := range markerSet[AggregateDefinition.Name] {
+				aggregate := markerValue.(Aggregate)
+				if len(aggregate.To) == 0 && len(aggregate.Labels) == 0 {
+					err := fmt.Errorf("RBAC aggregate marker must specify to or labels")
+					root.AddError(loader.ErrFromNode(err, markerNode(file, AggregateDefinition, aggregate)))
+					continue
+				}
+				roleName := aggregate.Role
+				if roleName == "" {
+					roleName = g.RoleName
+				}
+				if aggregationLabels[roleName] == nil {
+					aggregationLabels[roleName] = make(map[string]string)
+				}
+				for key, value := range aggregate.labels() {
+					aggregationLabels[roleName][key] = value
+				}
+				aggregateMarkers = append(aggregateMarkers, aggregateMarker{root: root, file: file, value: aggregate, roleName: roleName})
 			}
-			rulesByNS[namespace] = append(rulesByNS[namespace], &rule)
 		}
 	}
 
+	clusterRole := roleRef{Name: g.RoleName}
+	if len(g.AggregationSelector) > 0 {
+		if _, ok := rulesByRole[clusterRole]; ok {
+			return nil, fmt.Errorf("ClusterRole %q aggregates other ClusterRoles, so it cannot have rules of its own", g.RoleName)
+		}
+		rulesByRole[clusterRole] = nil
+	}
+
 	// NormalizeRules merge Rule with the same ruleKey and sort the Rules
 	NormalizeRules := func(rules []*Rule) []rbacv1.PolicyRule {
 		ruleMap := make(map[ruleKey]*Rule)
 		// all the Rules having the same ruleKey will be merged into the first Rule
 		for _, rule := range rules {
 			key := rule.key()
+			// expand the wildcard before merging, so that it doesn't absorb
+			// verbs like bind or escalate which it would no longer grant
+			if g.ExpandWildcardVerbs {
+				rule.expandWildcardVerbs()
+			}
 			if _, ok := ruleMap[key]; !ok {
 				ruleMap[key] = rule
 				continue
@@ -194,6 +599,17 @@ func GenerateRoles(ctx *genall.GenerationContext, roleName string) ([]interface{
 			ruleMap[key].addVerbs(rule.Verbs)
 		}
 
+		// drop the Rules which are made redundant by a Rule granting
+		// their verbs on all the resources of the same groups
+		for key, rule := range ruleMap {
+			for _, other := range ruleMap {
+				if other != rule && other.covers(rule) {
+					delete(ruleMap, key)
+					break
+				}
+			}
+		}
+
 		// sort the Rules in rules according to their ruleKeys
 		keys := make([]ruleKey, 0, len(ruleMap))
 		for key := range ruleMap {
@@ -203,35 +619,61 @@ func GenerateRoles(ctx *genall.GenerationContext, roleName string) ([]interface{
 
 		var policyRules []rbacv1.PolicyRule
 		for _, key := range keys {
-			policyRules = append(policyRules, ruleMap[key].ToRule())
+			rule := ruleMap[key]
+			policyRules = append(policyRules, rule.ToRule())
 
 		}
 		return policyRules
 	}
 
-	// collect all the namespaces and sort them
-	var namespaces []string
-	for ns := range rulesByNS {
-		namespaces = append(namespaces, ns)
+	// collect all the roles and sort them by namespace, then name
+	var roles []roleRef
+	for role := range rulesByRole {
+		roles = append(roles, role)
 	}
-	sort.Strings(namespaces)
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].Namespace != roles[j].Namespace {
+			return roles[i].Namespace < roles[j].Namespace
+		}
+		return roles[i].Name < roles[j].Name
+	})
 
-	// process the items in rulesByNS by the order specified in `namespaces` to make sure that the Role order is stable
+	// process the items in rulesByRole by the order specified in `roles` to make sure that the Role order is stable
 	var objs []interface{}
-	for _, ns := range namespaces {
-		rules := rulesByNS[ns]
+	clusterRoleNames := sets.NewString()
+	for _, role := range roles {
+		rules := rulesByRole[role]
 		policyRules := NormalizeRules(rules)
-		if len(policyRules) == 0 {
+		if len(policyRules) == 0 && (role != clusterRole || len(g.AggregationSelector) == 0) {
 			continue
 		}
-		if ns == "" {
+		if role.Namespace == "" {
+			clusterRoleNames.Insert(role.Name)
+		}
+		if role == clusterRole {
+			objs = append(objs, rbacv1.ClusterRole{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "ClusterRole",
+					APIVersion: apiVersion,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        g.RoleName,
+					Labels:      aggregationLabels[g.RoleName],
+					Annotations: g.annotations(),
+				},
+				Rules:           policyRules,
+				AggregationRule: g.aggregationRule(),
+			})
+		} else if role.Namespace == "" {
 			objs = append(objs, rbacv1.ClusterRole{
 				TypeMeta: metav1.TypeMeta{
 					Kind:       "ClusterRole",
-					APIVersion: rbacv1.SchemeGroupVersion.String(),
+					APIVersion: apiVersion,
 				},
 				ObjectMeta: metav1.ObjectMeta{
-					Name: roleName,
+					Name:        role.Name,
+					Labels:      aggregationLabels[role.Name],
+					Annotations: g.annotations(),
 				},
 				Rules: policyRules,
 			})
@@ -239,27 +681,72 @@ func GenerateRoles(ctx *genall.GenerationContext, roleName string) ([]interface{
 			objs = append(objs, rbacv1.Role{
 				TypeMeta: metav1.TypeMeta{
 					Kind:       "Role",
-					APIVersion: rbacv1.SchemeGroupVersion.String(),
+					APIVersion: apiVersion,
 				},
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      roleName,
-					Namespace: ns,
+					Name:        role.Name,
+					Namespace:   role.Namespace,
+					Annotations: g.annotations(),
 				},
 				Rules: policyRules,
 			})
 		}
 	}
 
+	// the labels of aggregate markers are only set on generated ClusterRoles,
+	// so report the ones which would be lost
+	for _, marker := range aggregateMarkers {
+		if !clusterRoleNames.Has(marker.roleName) {
+			err := fmt.Errorf("no ClusterRole named %q is generated, so it cannot be aggregated", marker.roleName)
+			marker.root.AddError(loader.ErrFromNode(err, markerNode(marker.file, AggregateDefinition, marker.value)))
+		}
+	}
+
 	return objs, nil
 }
 
+// apiVersion returns the group-version of the RBAC API the roles are
+// generated for.
+func (g Generator) apiVersion() (string, error) {
+	switch g.Version {
+	case "", "v1":
+		return rbacv1.SchemeGroupVersion.String(), nil
+	case "v1beta1":
+		return rbacv1beta1.SchemeGroupVersion.String(), nil
+	default:
+		return "", fmt.Errorf("unknown RBAC API version %q, expected v1 or v1beta1", g.Version)
+	}
+}
+
+// annotations returns the annotations of a generated role, attributing it to
+// controller-gen along with the version info.
+func (g Generator) annotations() map[string]string {
+	if g.SkipVersionAnnotation {
+		return nil
+	}
+	return map[string]string{"controller-gen.kubebuilder.io/version": version.Version()}
+}
+
+// aggregationRule returns the AggregationRule of the ClusterRole, if any.
+func (g Generator) aggregationRule() *rbacv1.AggregationRule {
+	if len(g.AggregationSelector) == 0 {
+		return nil
+	}
+	return &rbacv1.AggregationRule{
+		ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: g.AggregationSelector}},
+	}
+}
+
 func (g Generator) Generate(ctx *genall.GenerationContext) error {
-	objs, err := GenerateRoles(ctx, g.RoleName)
+	objs, err := g.generateRoles(ctx)
 	if err != nil {
 		return err
 	}
 
 	if len(objs) == 0 {
+		if g.FailOnEmpty {
+			return fmt.Errorf("no roles generated: found no valid +%s markers in the loaded packages", RuleDefinition.Name)
+		}
 		return nil
 	}
 
@@ -3,14 +3,17 @@ package rbac_test
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/google/go-cmp/cmp"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"sigs.k8s.io/controller-tools/pkg/genall"
 	"sigs.k8s.io/controller-tools/pkg/loader"
@@ -34,9 +37,9 @@ var _ = Describe("ClusterRole generated by the RBAC Generator", func() {
 			pkgs, err := loader.LoadRoots(".")
 			Expect(err).NotTo(HaveOccurred())
 
-			By("registering RBAC rule marker")
+			By("registering RBAC markers")
 			reg := &markers.Registry{}
-			Expect(reg.Register(rbac.RuleDefinition)).To(Succeed())
+			Expect(rbac.Generator{}.RegisterMarkers(reg)).To(Succeed())
 
 			By("creating GenerationContext")
 			ctx := &genall.GenerationContext{
@@ -71,3 +74,259 @@ var _ = Describe("ClusterRole generated by the RBAC Generator", func() {
 		})
 	}
 })
+
+var _ = Describe("RBAC Generator", func() {
+	Context("with invalid rules", func() {
+		var ctx *genall.GenerationContext
+		var pkg *loader.Package
+		BeforeEach(func() {
+			ctx, pkg = loadTestPackage("./invalid")
+		})
+
+		It("should report invalid rules", func() {
+			By("generating a ClusterRole")
+			objs, err := rbac.GenerateRoles(ctx, "manager-role")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objs).To(BeEmpty())
+
+			By("checking the errors reported against the package")
+			Expect(packageErrors(pkg)).To(ConsistOf(
+				HavePrefix(`3: invalid API group "apps/v1"`),
+				HavePrefix(`4: RBAC rule for non-resource URLs [/healthz] must not specify groups, resources or resourceNames`),
+				HavePrefix(`5: RBAC rule for non-resource URLs [/metrics] must not specify a namespace`),
+				HavePrefix(`6: unknown verb "lst"`),
+				HavePrefix(`7: invalid resource "deployments/"`),
+				HavePrefix(`8: unknown verb "read-only"`),
+				HavePrefix(`9: no ClusterRole named "cronjob-viewr-role" is generated`),
+				HavePrefix(`10: RBAC aggregate marker must specify to or labels`),
+			))
+		})
+
+		It("should accept unknown verbs when asked to", func() {
+			By("calling Generate")
+			out := &outputRule{buf: &bytes.Buffer{}}
+			ctx.OutputRule = out
+			Expect(rbac.Generator{RoleName: "manager-role", AllowUnknownVerbs: true}.Generate(ctx)).To(Succeed())
+
+			By("checking that only the other invalid rules were reported")
+			Expect(packageErrors(pkg)).NotTo(ContainElement(ContainSubstring("unknown verb")))
+			Expect(packageErrors(pkg)).NotTo(BeEmpty())
+
+			By("checking that the rules with unknown verbs were generated")
+			Expect(out.buf.String()).To(ContainSubstring("- lst\n"))
+
+			By("checking that verb aliases were not expanded for non-resource URLs")
+			Expect(out.buf.String()).To(ContainSubstring("- read-only\n"))
+			Expect(out.buf.String()).NotTo(ContainSubstring("- watch\n"))
+		})
+
+		It("should fail if no roles are generated when asked to", func() {
+			ctx.OutputRule = &outputRule{buf: &bytes.Buffer{}}
+			Expect(rbac.Generator{RoleName: "manager-role"}.Generate(ctx)).To(Succeed())
+			err := rbac.Generator{RoleName: "manager-role", FailOnEmpty: true}.Generate(ctx)
+			Expect(err).To(MatchError(ContainSubstring("no roles generated")))
+		})
+	})
+
+	It("should select the ClusterRoles to aggregate by label when asked to", func() {
+		selector := map[string]string{"rbac.example.com/aggregate-to-manager": "true"}
+		out, pkg, err := generate("./aggregated", rbac.Generator{RoleName: "manager-role", AggregationSelector: selector})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pkg.Errors).To(BeEmpty())
+		roles := generatedRoles(out)
+		Expect(roles).To(HaveLen(2))
+
+		By("checking the ClusterRole")
+		Expect(roles[0].Kind).To(Equal("ClusterRole"))
+		Expect(roles[0].Rules).To(BeEmpty())
+		Expect(roles[0].AggregationRule).To(Equal(&rbacv1.AggregationRule{
+			ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: selector}},
+		}))
+
+		By("checking that namespaced rules still produce a Role")
+		Expect(roles[1].Kind).To(Equal("Role"))
+		Expect(roles[1].Namespace).To(Equal("system"))
+	})
+
+	It("should refuse to aggregate into a ClusterRole with rules", func() {
+		selector := map[string]string{"rbac.example.com/aggregate-to-manager": "true"}
+		_, _, err := generate(".", rbac.Generator{RoleName: "manager-role", AggregationSelector: selector})
+		Expect(err).To(MatchError(ContainSubstring("cannot have rules of its own")))
+	})
+
+	It("should replace the wildcard verb with the standard verbs when asked to", func() {
+		out, pkg, err := generate(".", rbac.Generator{RoleName: "manager-role", ExpandWildcardVerbs: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pkg.Errors).To(BeEmpty())
+
+		var rules []rbacv1.PolicyRule
+		for _, role := range generatedRoles(out) {
+			rules = append(rules, role.Rules...)
+		}
+		Expect(rules).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups: []string{"batch.io"},
+			Resources: []string{"cronjobs/finalizers"},
+			Verbs:     []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"},
+		}))
+		for _, rule := range rules {
+			Expect(rule.Verbs).NotTo(ContainElement(rbacv1.VerbAll))
+		}
+
+		By("checking that explicitly granted verbs are kept")
+		out, pkg, err = generate("./options", rbac.Generator{RoleName: "manager-role", ExpandWildcardVerbs: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pkg.Errors).To(BeEmpty())
+		roles := generatedRoles(out)
+		Expect(roles).To(HaveLen(1))
+		Expect(roles[0].Rules).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups: []string{"rbac.authorization.k8s.io"},
+			Resources: []string{"clusterroles"},
+			Verbs:     []string{"bind", "create", "delete", "deletecollection", "escalate", "get", "list", "patch", "update", "watch"},
+		}))
+		Expect(roles[0].Rules).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups: []string{"policy"},
+			Resources: []string{"podsecuritypolicies"},
+			Verbs:     []string{"use"},
+		}))
+
+		By("checking that rules limited to resourceNames don't get create or deletecollection")
+		Expect(roles[0].Rules).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups:     []string{"batch"},
+			Resources:     []string{"jobs"},
+			ResourceNames: []string{"archive"},
+			Verbs:         []string{"delete", "get", "list", "patch", "update", "watch"},
+		}))
+	})
+
+	It("should not annotate the roles with the version when asked to", func() {
+		out, _, err := generate(".", rbac.Generator{RoleName: "manager-role", SkipVersionAnnotation: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("kind: ClusterRole\n"))
+		Expect(out).NotTo(ContainSubstring("controller-gen.kubebuilder.io/version"))
+	})
+
+	It("should generate v1beta1 roles when asked to", func() {
+		out, _, err := generate(".", rbac.Generator{RoleName: "manager-role", Version: "v1beta1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("apiVersion: rbac.authorization.k8s.io/v1beta1\n"))
+		Expect(out).NotTo(ContainSubstring("apiVersion: rbac.authorization.k8s.io/v1\n"))
+	})
+
+	It("should reject unknown RBAC API versions", func() {
+		_, _, err := generate(".", rbac.Generator{RoleName: "manager-role", Version: "v2"})
+		Expect(err).To(MatchError(ContainSubstring(`unknown RBAC API version "v2"`)))
+	})
+
+	It("should allow wildcard rules and unnamed verbs on named resources by default", func() {
+		out, pkg, err := generate("./options", rbac.Generator{RoleName: "manager-role"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pkg.Errors).To(BeEmpty())
+		roles := generatedRoles(out)
+		Expect(roles).To(HaveLen(1))
+		Expect(roles[0].Rules).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups:     []string{"batch"},
+			Resources:     []string{"jobs"},
+			ResourceNames: []string{"cleanup"},
+			Verbs:         []string{"create", "get", "list"},
+		}))
+	})
+
+	It("should report rules granting all verbs on all resources when asked to", func() {
+		out, pkg, err := generate("./options", rbac.Generator{RoleName: "manager-role", ForbidWildcardRules: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packageErrors(pkg)).To(ConsistOf(
+			HavePrefix(`3: RBAC rule grants all verbs on all resources of the API groups [apps]`),
+			HavePrefix(`9: RBAC rule grants all verbs on all resources of the API groups [policy]`),
+		))
+
+		By("checking that rules limited to resourceNames were generated")
+		Expect(out).To(ContainSubstring("- foo\n"))
+	})
+
+	It("should report unnamed verbs on named resources when asked to", func() {
+		out, pkg, err := generate("./options", rbac.Generator{RoleName: "manager-role", ForbidUnnamedVerbsOnNamedResources: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packageErrors(pkg)).To(ConsistOf(
+			HavePrefix(`6: RBAC rule for resourceNames [cleanup] cannot grant verbs [create]`),
+		))
+		Expect(out).NotTo(ContainSubstring("- cleanup\n"))
+	})
+})
+
+// generate runs g on the given package of the testdata module, and returns
+// its output and the package, along with the error returned by Generate.
+func generate(root string, g rbac.Generator) (string, *loader.Package, error) {
+	ctx, pkg := loadTestPackage(root)
+	out := &outputRule{buf: &bytes.Buffer{}}
+	ctx.OutputRule = out
+	By("calling Generate")
+	err := g.Generate(ctx)
+	return out.buf.String(), pkg, err
+}
+
+// generatedRoles parses the ClusterRoles and Roles written by Generate.
+// Roles are parsed as ClusterRoles as well, since they have the same fields.
+func generatedRoles(out string) []rbacv1.ClusterRole {
+	var roles []rbacv1.ClusterRole
+	for _, doc := range strings.Split(out, "\n---\n")[1:] {
+		var role rbacv1.ClusterRole
+		Expect(yaml.Unmarshal([]byte(doc), &role)).To(Succeed())
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// loadTestPackage loads the given package of the testdata module, and
+// returns it together with a GenerationContext for it.
+func loadTestPackage(root string) (*genall.GenerationContext, *loader.Package) {
+	By("switching into testdata to appease go modules")
+	cwd, err := os.Getwd()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.Chdir("./testdata")).To(Succeed()) // go modules are directory-sensitive
+	defer func() { Expect(os.Chdir(cwd)).To(Succeed()) }()
+
+	By("loading the roots")
+	pkgs, err := loader.LoadRoots(root)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pkgs).To(HaveLen(1))
+
+	By("registering RBAC markers")
+	reg := &markers.Registry{}
+	Expect(rbac.Generator{}.RegisterMarkers(reg)).To(Succeed())
+
+	By("creating GenerationContext")
+	ctx := &genall.GenerationContext{
+		Collector: &markers.Collector{Registry: reg},
+		Roots:     pkgs,
+	}
+	return ctx, pkgs[0]
+}
+
+// packageErrors returns the errors reported against pkg, as
+// "<line>: <message>", with <line> being the line of the offending marker.
+func packageErrors(pkg *loader.Package) []string {
+	var errs []string
+	for _, pkgErr := range pkg.Errors {
+		pos := strings.Split(pkgErr.Pos, ":")
+		Expect(pos).To(HaveLen(3))
+		Expect(pos[0]).To(HaveSuffix("controller.go"))
+		errs = append(errs, fmt.Sprintf("%s: %s", pos[1], pkgErr.Msg))
+	}
+	return errs
+}
+
+type outputRule struct {
+	buf *bytes.Buffer
+}
+
+func (o *outputRule) Open(_ *loader.Package, itemPath string) (io.WriteCloser, error) {
+	return nopCloser{o.buf}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (n nopCloser) Close() error {
+	return nil
+}
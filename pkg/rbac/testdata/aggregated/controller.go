@@ -0,0 +1,3 @@
+package aggregated
+
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;update,namespace=system
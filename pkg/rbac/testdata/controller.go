@@ -11,3 +11,20 @@ package controller
 // +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=watch;watch
 // +kubebuilder:rbac:groups=art,resources=jobs,verbs=get,namespace=park
 // +kubebuilder:rbac:groups=batch.io,resources=cronjobs,resourceNames=foo;bar;baz,verbs=get;watch
+// +kubebuilder:rbac:groups=batch.io,resources=cronjobs/finalizers,verbs=update
+// +kubebuilder:rbac:groups=batch.io,resources=cronjobs/finalizers,verbs=*;get
+// +kubebuilder:rbac:aggregate:to=admin;edit
+// +kubebuilder:rbac:aggregate:labels={rbac.example.com/aggregate-to-manager: "true"}
+// +kubebuilder:rbac:groups=apps,resources=*,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments;replicasets,verbs=get;list
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=update
+// +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=list
+// +kubebuilder:rbac:urls=/healthz;/metrics,verbs=get
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch,role=event-recorder-role
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;create;update,namespace=system,role=leader-election-role
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=read-only
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=csidrivers,verbs=Read-Write;deletecollection
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=volumeattachments,verbs=all
+// +kubebuilder:rbac:groups=batch.io,resources=cronjobs,verbs=read-only,role=cronjob-viewer-role
+// +kubebuilder:rbac:aggregate:to=view,role=cronjob-viewer-role
@@ -0,0 +1,10 @@
+package invalid
+
+// +kubebuilder:rbac:groups=apps/v1,resources=deployments,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods,urls=/healthz,verbs=get
+// +kubebuilder:rbac:urls=/metrics,verbs=get,namespace=zoo
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;lst
+// +kubebuilder:rbac:groups=apps,resources=deployments/,verbs=get
+// +kubebuilder:rbac:urls=/metrics,verbs=read-only
+// +kubebuilder:rbac:aggregate:to=view,role=cronjob-viewr-role
+// +kubebuilder:rbac:aggregate:role=cronjob-viewer-role
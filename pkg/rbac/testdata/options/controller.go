@@ -0,0 +1,12 @@
+package options
+
+// +kubebuilder:rbac:groups=apps,resources=*,verbs=*
+// +kubebuilder:rbac:groups=apps,resources=*,verbs=get;list
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=all
+// +kubebuilder:rbac:groups=batch,resources=jobs,resourceNames=cleanup,verbs=get;list;create
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=*
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=escalate;bind
+// +kubebuilder:rbac:groups=policy,resources=*,verbs=*
+// +kubebuilder:rbac:groups=policy,resources=podsecuritypolicies,verbs=use
+// +kubebuilder:rbac:groups=batch,resources=jobs,resourceNames=archive,verbs=*
+// +kubebuilder:rbac:groups=apps,resources=*,resourceNames=foo,verbs=*
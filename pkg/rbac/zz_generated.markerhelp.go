@@ -24,6 +24,30 @@ import (
 	"sigs.k8s.io/controller-tools/pkg/markers"
 )
 
+func (Aggregate) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "RBAC",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "specifies ClusterRoles that a generated ClusterRole should be aggregated into.",
+			Details: "",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{
+			"To": markers.DetailedHelp{
+				Summary: "specifies the names of the aggregating ClusterRoles, e.g. admin, edit or view. ",
+				Details: "The generated ClusterRole is labeled with `rbac.authorization.k8s.io/aggregate-to-<name>: \"true\"` for each of them, which is what the aggregationRules of the default user-facing roles select on.",
+			},
+			"Labels": markers.DetailedHelp{
+				Summary: "specifies additional labels to set on the generated ClusterRole, for aggregated ClusterRoles selecting on labels of their own, e.g. `{rbac.example.com/aggregate-to-manager: \"true\"}`.",
+				Details: "",
+			},
+			"Role": markers.DetailedHelp{
+				Summary: "specifies the name of the generated ClusterRole to aggregate, as set with the role argument of rule markers. If not set, the ClusterRole named by the generator's roleName option is aggregated.",
+				Details: "",
+			},
+		},
+	}
+}
+
 func (Generator) Help() *markers.DefinitionHelp {
 	return &markers.DefinitionHelp{
 		Category: "",
@@ -36,6 +60,38 @@ func (Generator) Help() *markers.DefinitionHelp {
 				Summary: "sets the name of the generated ClusterRole.",
 				Details: "",
 			},
+			"AllowUnknownVerbs": markers.DetailedHelp{
+				Summary: "disables the check that rules only use the known Kubernetes API verbs. ",
+				Details: "This is needed for the custom verbs of some aggregated APIs.",
+			},
+			"AggregationSelector": markers.DetailedHelp{
+				Summary: "turns the ClusterRole into an aggregated role, combining the rules of all ClusterRoles with these labels. ",
+				Details: "Its rules are then managed by Kubernetes, so rules without a namespace cannot be used alongside it.",
+			},
+			"ExpandWildcardVerbs": markers.DetailedHelp{
+				Summary: "replaces the wildcard verb in the generated rules with the standard verbs it grants. ",
+				Details: "This is for policy tooling that forbids wildcard verbs.  Unlike the wildcard, the expanded verbs do not include special verbs such as bind or escalate, unless other rules grant them explicitly.  Rules limited to resourceNames don't get create or deletecollection.",
+			},
+			"FailOnEmpty": markers.DetailedHelp{
+				Summary: "makes generation fail if no roles are generated. ",
+				Details: "This catches paths that don't point at the packages holding the RBAC markers.",
+			},
+			"SkipVersionAnnotation": markers.DetailedHelp{
+				Summary: "omits the annotation recording the version of controller-gen from the generated roles.",
+				Details: "",
+			},
+			"Version": markers.DetailedHelp{
+				Summary: "sets the version of the RBAC API to generate roles for: v1 (the default) or v1beta1. ",
+				Details: "v1beta1 is only needed for clusters older than Kubernetes 1.8; the roles are the same in both versions.",
+			},
+			"ForbidWildcardRules": markers.DetailedHelp{
+				Summary: "reports an error for rules granting all verbs on all resources of their API groups. ",
+				Details: "For groups like core or apps, such rules are as good as cluster-admin, and are usually broader than intended.",
+			},
+			"ForbidUnnamedVerbsOnNamedResources": markers.DetailedHelp{
+				Summary: "reports an error for rules limited to resourceNames that grant create or deletecollection. ",
+				Details: "Requests for those verbs aren't for a named resource, so such rules never grant them.  (list and watch requests are, when they select a single object with a metadata.name field selector.)",
+			},
 		},
 	}
 }
@@ -61,8 +117,8 @@ func (Rule) Help() *markers.DefinitionHelp {
 				Details: "Create requests cannot be restricted by resourcename, as the object's name is not known at authorization time.",
 			},
 			"Verbs": markers.DetailedHelp{
-				Summary: "specifies the (lowercase) kubernetes API verbs that this rule encompasses.",
-				Details: "",
+				Summary: "specifies the (lowercase) kubernetes API verbs that this rule encompasses. ",
+				Details: "For API resources, the aliases read-only (get, list and watch), read-write (read-only plus create, update, patch and delete) and all (*) may be used as well.",
 			},
 			"URLs": markers.DetailedHelp{
 				Summary: "URL specifies the non-resource URLs that this rule encompasses.",
@@ -72,6 +128,10 @@ func (Rule) Help() *markers.DefinitionHelp {
 				Summary: "specifies the scope of the Rule. If not set, the Rule belongs to the generated ClusterRole. If set, the Rule belongs to a Role, whose namespace is specified by this field.",
 				Details: "",
 			},
+			"Role": markers.DetailedHelp{
+				Summary: "specifies the name of the ClusterRole or Role the Rule belongs to, to split the permissions of a controller into several roles. If not set, the Rule belongs to the role named by the generator's roleName option.",
+				Details: "",
+			},
 		},
 	}
 }